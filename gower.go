@@ -34,8 +34,6 @@ import (
 	"runtime"
 	"strconv"
 	"time"
-
-	"github.com/flosch/pongo2"
 )
 
 const (
@@ -49,14 +47,16 @@ const (
 
 // Server Configuration
 type Config struct {
-	Port        int
-	Host        string
-	StaticDir   string
-	TemplateDir string
-	Csrf        bool
-	Routes      []*Route
-	ColoredLog  bool
-	Debug       bool
+	Port            int
+	Host            string
+	StaticDir       string
+	TemplateDir     string
+	Csrf            bool
+	Routes          []*Route
+	ColoredLog      bool
+	Debug           bool
+	WatchTemplates  bool
+	ShutdownTimeout time.Duration
 }
 
 // Context contains the `Request`, `Response` and `Matches` vars
@@ -64,18 +64,43 @@ type Context struct {
 	Res     http.ResponseWriter
 	Req     *http.Request
 	Matches []string
+	Params  map[string]string
+
+	values map[string]interface{}
 }
 
-// Route contains the compiled pattern for the url, the method and the handler
+// Route contains the compiled pattern for the url, the method, the handler
+// and any middleware that applies only to this route
 type Route struct {
-	re      *regexp.Regexp // url pattern to match
-	method  string         // request method
-	handler func(*Context) // func to run
+	pattern     string         // original url pattern, for labels/logging
+	re          *regexp.Regexp // url pattern to match (regex routes only)
+	method      string         // request method
+	handler     func(*Context) // func to run
+	middlewares []Middleware
+}
+
+// Middleware wraps a handler with cross-cutting behaviour (auth, gzip,
+// request-ID injection, panic recovery, rate limiting, logging, ...). It
+// receives the next handler in the chain and returns the wrapped one.
+type Middleware func(next func(*Context)) func(*Context)
+
+// statusRecorder wraps a ResponseWriter to remember the status code actually
+// written, so process() can record accurate stats/metrics even when
+// middleware writes a response itself (e.g. csrfMiddleware's 403) instead of
+// calling next and letting the matched handler run.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
 }
 
-var templateCache = make(map[string]pongo2.Template)
 var ServerConfig = &Config{}
 var ServerStat = NewStat()
+var globalMiddleware []Middleware
 
 // ----------------
 // Context Methods
@@ -87,50 +112,6 @@ func (c *Context) Write(data ...interface{}) {
 	fmt.Fprint(c.Res, data...)
 }
 
-//
-func renderTemplate(filepath string, data map[string]interface{}) []byte {
-
-	var out string
-	var err error
-	var template pongo2.Template
-
-	// Read the template from the disk every time
-	if ServerConfig.Debug {
-		newTemplate, err := pongo2.FromFile(filepath)
-		if err != nil {
-			panic(err)
-		}
-		template = *newTemplate
-
-	} else {
-		// Read the template and cache it
-		cached, ok := templateCache[filepath]
-		if ok == false {
-			newTemplate, err := pongo2.FromFile(filepath)
-			if err != nil {
-				panic(err)
-			}
-			templateCache[filepath] = *newTemplate
-			cached = *newTemplate
-		}
-		template = cached
-	}
-
-	out, err = template.Execute(data)
-	if err != nil {
-		panic(err)
-	}
-	return []byte(out)
-}
-
-// Render template and write it to Response
-func (c *Context) WriteTemplate(filename string, data map[string]interface{}) {
-	c.Res.Header().Set("Content-Type", "text/html; charset=utf-8")
-	filepath := ServerConfig.TemplateDir + "/" + filename
-	str := renderTemplate(filepath, data)
-	c.Res.Write(str)
-}
-
 // Write json response
 func (c *Context) WriteJson(data interface{}) {
 	c.Res.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -141,6 +122,23 @@ func (c *Context) WriteJson(data interface{}) {
 	c.Res.Write(out)
 }
 
+// Set stores a value on the Context so later middleware and the handler can
+// read it back with Get (request ID, authenticated user, start time, ...)
+func (c *Context) Set(key string, val interface{}) {
+	if c.values == nil {
+		c.values = make(map[string]interface{})
+	}
+	c.values[key] = val
+}
+
+// Get retrieves a value previously stored with Set, or nil if absent
+func (c *Context) Get(key string) interface{} {
+	if c.values == nil {
+		return nil
+	}
+	return c.values[key]
+}
+
 // --------
 // Methods
 // --------
@@ -152,11 +150,22 @@ func NewConfig() *Config {
 
 // Create a new Route
 func NewRoute(pattern string, method string, handler func(*Context)) *Route {
+	return NewRouteWith(pattern, method, nil, handler)
+}
+
+// Create a new Route with per-route middleware
+func NewRouteWith(pattern string, method string, mws []Middleware, handler func(*Context)) *Route {
 	re, err := regexp.Compile("^" + pattern + "$")
 	if err != nil {
 		log.Fatal(err)
 	}
-	return &Route{re, method, handler}
+	return &Route{pattern: pattern, re: re, method: method, handler: handler, middlewares: mws}
+}
+
+// Use registers global middleware, applied to every route in registration
+// order, ahead of any per-route middleware
+func Use(mws ...Middleware) {
+	globalMiddleware = append(globalMiddleware, mws...)
 }
 
 // Load templates from path
@@ -178,7 +187,18 @@ func ServeStatic() http.Handler {
 
 // Register new route
 func RegisterRoute(path string, method string, fun func(c *Context)) {
-	route := NewRoute(path, method, fun)
+	RegisterRouteWith(path, method, nil, fun)
+}
+
+// Register new route with per-route middleware. Patterns with named
+// parameters (":id") or a trailing wildcard ("*path") are registered in the
+// trie router; everything else keeps using the regex route list.
+func RegisterRouteWith(path string, method string, mws []Middleware, fun func(c *Context)) {
+	if isTriePattern(path) {
+		addTrieRoute(path, method, mws, fun)
+		return
+	}
+	route := NewRouteWith(path, method, mws, fun)
 	ServerConfig.Routes = append(ServerConfig.Routes, route)
 }
 
@@ -191,21 +211,41 @@ func Get(path string, fun func(c *Context)) {
 	RegisterRoute(path, "GET", fun)
 }
 
+// Create and register a new GET route with per-route middleware
+func GetWith(path string, mws []Middleware, fun func(c *Context)) {
+	RegisterRouteWith(path, "GET", mws, fun)
+}
+
 // Create and register a new POST route
 func Post(path string, fun func(c *Context)) {
 	RegisterRoute(path, "POST", fun)
 }
 
+// Create and register a new POST route with per-route middleware
+func PostWith(path string, mws []Middleware, fun func(c *Context)) {
+	RegisterRouteWith(path, "POST", mws, fun)
+}
+
 // Create and register a new DELETE route
 func Delete(path string, fun func(c *Context)) {
 	RegisterRoute(path, "DELETE", fun)
 }
 
+// Create and register a new DELETE route with per-route middleware
+func DeleteWith(path string, mws []Middleware, fun func(c *Context)) {
+	RegisterRouteWith(path, "DELETE", mws, fun)
+}
+
 // Create and register a new PUT route
 func Put(path string, fun func(c *Context)) {
 	RegisterRoute(path, "PUT", fun)
 }
 
+// Create and register a new PUT route with per-route middleware
+func PutWith(path string, mws []Middleware, fun func(c *Context)) {
+	RegisterRouteWith(path, "PUT", mws, fun)
+}
+
 // ----------
 // OTHER
 // ----------
@@ -221,7 +261,10 @@ func Process(w http.ResponseWriter, r *http.Request) {
 			method := fmt.Sprintf("%s (%s)", r.Method, err)
 			logRequest(r.URL.Path, method, r.RemoteAddr, false, time.Since(reqStarted))
 			http.Error(w, "Server Error", 500)
-			ServerStat.Increment(500, time.Since(reqStarted))
+			duration := time.Since(reqStarted)
+			ServerStat.Increment(500, duration)
+			httpRequestsTotal.WithLabelValues(r.Method, "panic", "500").Inc()
+			httpRequestDuration.WithLabelValues(r.Method, "panic", "500").Observe(duration.Seconds())
 		}
 	}()
 	process(w, r)
@@ -230,45 +273,69 @@ func Process(w http.ResponseWriter, r *http.Request) {
 // Process a request
 func process(w http.ResponseWriter, r *http.Request) {
 
+	httpRequestsInFlight.Inc()
+	defer httpRequestsInFlight.Dec()
+
 	reqStarted := time.Now()
 
 	var foundPattern bool = false
 	var foundMethod bool = false
 	var routeToExecute *Route
 	var foundMatches []string
-
-	// Find the Route to serve this request
-	for _, route := range ServerConfig.Routes {
-		if matches := route.re.FindStringSubmatch(r.URL.Path); matches != nil {
-			foundPattern = true
-			if foundPattern {
-				foundMethod = (route.method == r.Method)
-			}
-			if foundPattern && foundMethod {
-				routeToExecute = route
-				foundMatches = matches
-				break
+	var foundParams map[string]string
+
+	// Try the trie router first (named-parameter and wildcard routes). Only
+	// fall back to the linear regex scan when the trie has no exact match,
+	// so a regex route isn't shadowed just because some other method has a
+	// trie route under the same path (that would wrongly turn into a 405).
+	if route, params := matchTrie(r.Method, r.URL.Path); route != nil {
+		foundPattern = true
+		foundMethod = true
+		routeToExecute = route
+		foundParams = params
+	} else {
+		for _, route := range ServerConfig.Routes {
+			if matches := route.re.FindStringSubmatch(r.URL.Path); matches != nil {
+				foundPattern = true
+				if route.method == r.Method {
+					foundMethod = true
+					routeToExecute = route
+					foundMatches = matches
+					break
+				}
 			}
 		}
+		if !foundMethod && trieMatchesPath(r.URL.Path, r.Method) {
+			foundPattern = true
+		}
 	}
 
-	statusCode := 200
-	// Not found
-	if !foundPattern {
-		http.Error(w, "Not Found", 404)
-		statusCode = 404
-	} else if !foundMethod { // Invalid Method
-		http.Error(w, "Method not allowed", 405)
-		statusCode = 405
+	statusRec := &statusRecorder{ResponseWriter: w, status: 200}
+	context := &Context{Res: statusRec, Req: r, Matches: foundMatches, Params: foundParams}
+
+	var handler func(*Context)
+	switch {
+	case foundMethod && foundPattern:
+		handler = routeToExecute.handler
+		for i := len(routeToExecute.middlewares) - 1; i >= 0; i-- {
+			handler = routeToExecute.middlewares[i](handler)
+		}
+	case foundPattern: // Invalid method
+		handler = func(c *Context) { http.Error(c.Res, "Method not allowed", 405) }
+	default: // Not found
+		handler = func(c *Context) { http.Error(c.Res, "Not Found", 404) }
 	}
 
-	// If all is good
-	if foundMethod && foundPattern {
-		// Execute the routes handler
-		context := &Context{Res: w, Req: r, Matches: foundMatches}
-		routeToExecute.handler(context)
+	// Global middleware wraps every request, including 404/405 responses,
+	// so rate limiting and logging registered via Use() still see requests
+	// that never reach a matched route.
+	chain := handler
+	for i := len(globalMiddleware) - 1; i >= 0; i-- {
+		chain = globalMiddleware[i](chain)
 	}
+	chain(context)
 
+	statusCode := statusRec.status
 	duration := time.Since(reqStarted)
 
 	if ServerConfig.Debug {
@@ -277,6 +344,13 @@ func process(w http.ResponseWriter, r *http.Request) {
 
 	ServerStat.Increment(statusCode, duration)
 
+	pathPattern := "unmatched"
+	if routeToExecute != nil {
+		pathPattern = routeToExecute.pattern
+	}
+	status := strconv.Itoa(statusCode)
+	httpRequestsTotal.WithLabelValues(r.Method, pathPattern, status).Inc()
+	httpRequestDuration.WithLabelValues(r.Method, pathPattern, status).Observe(duration.Seconds())
 }
 
 // Log an incoming request (with colors if requested)
@@ -305,15 +379,6 @@ func showInfo() {
 	fmt.Print("\nServing\n\n")
 }
 
-// Start the server
-func Start() {
-	showInfo()
-	// Listen and serve
-	http.Handle("/static/", ServeStatic())
-	http.HandleFunc("/", Process)
-	log.Fatal(http.ListenAndServe(ServerConfig.Host, nil))
-}
-
 // Default command line options
 var (
 	port        = flag.Int("port", 8000, "Port number for server")
@@ -0,0 +1,49 @@
+package gower
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests, by method, matched route pattern and status",
+	}, []string{"method", "path_pattern", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds, by method, matched route pattern and status",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path_pattern", "status"})
+
+	httpRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being processed",
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "goroutines",
+		Help: "Number of goroutines currently running",
+	}, func() float64 { return float64(runtime.NumGoroutine()) })
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "uptime_seconds",
+		Help: "Seconds since the server started",
+	}, func() float64 { return ServerStat.GetUptime().Seconds() })
+)
+
+// EnablePrometheus registers a Prometheus metrics handler at path (default
+// "/metrics" when empty). process() records request counts and latency into
+// the same collectors on every request, alongside the existing Stat updates,
+// so both APIs stay in sync off a single call site.
+func EnablePrometheus(path string) {
+	if path == "" {
+		path = "/metrics"
+	}
+	http.Handle(path, promhttp.Handler())
+}
@@ -0,0 +1,164 @@
+package gower
+
+import (
+	"log"
+	"strings"
+)
+
+// node is one segment of the per-method trie used to match routes declared
+// with named parameters (`:id`) or a trailing wildcard (`*path`), so those
+// routes are resolved in O(depth) instead of walking every registered regex.
+type node struct {
+	children      map[string]*node
+	paramChild    *node
+	paramName     string
+	wildcardChild *node
+	wildcardName  string
+	route         *Route
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+// trieRoots holds one trie root per HTTP method
+var trieRoots = make(map[string]*node)
+
+// addTrieRoute registers pattern (e.g. "/users/:id/posts/:slug" or
+// "/files/*path") under method in the trie.
+func addTrieRoute(pattern string, method string, mws []Middleware, handler func(*Context)) {
+	root, ok := trieRoots[method]
+	if !ok {
+		root = newNode()
+		trieRoots[method] = root
+	}
+
+	cur := root
+	for _, seg := range splitPath(pattern) {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name := seg[1:]
+			if cur.paramChild == nil {
+				cur.paramChild = newNode()
+				cur.paramChild.paramName = name
+			} else if cur.paramChild.paramName != name {
+				log.Fatalf("gower: route %q uses param name %q where %q is already registered at the same position", pattern, name, cur.paramChild.paramName)
+			}
+			cur = cur.paramChild
+		case strings.HasPrefix(seg, "*"):
+			name := seg[1:]
+			if cur.wildcardChild == nil {
+				cur.wildcardChild = newNode()
+				cur.wildcardChild.wildcardName = name
+			} else if cur.wildcardChild.wildcardName != name {
+				log.Fatalf("gower: route %q uses wildcard name %q where %q is already registered at the same position", pattern, name, cur.wildcardChild.wildcardName)
+			}
+			cur = cur.wildcardChild
+		default:
+			child, ok := cur.children[seg]
+			if !ok {
+				child = newNode()
+				cur.children[seg] = child
+			}
+			cur = child
+		}
+	}
+	cur.route = &Route{pattern: pattern, method: method, handler: handler, middlewares: mws}
+}
+
+// isTriePattern reports whether pattern uses named-parameter syntax and so
+// belongs in the trie rather than the regex route list.
+func isTriePattern(pattern string) bool {
+	for _, seg := range splitPath(pattern) {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// matchTrie finds the Route registered for method/path in the trie, along
+// with the named parameters extracted from path. Returns a nil Route if no
+// trie route under that method matches.
+func matchTrie(method string, path string) (*Route, map[string]string) {
+	root, ok := trieRoots[method]
+	if !ok {
+		return nil, nil
+	}
+	return matchTrieNode(root, splitPath(path))
+}
+
+func matchTrieNode(root *node, segments []string) (*Route, map[string]string) {
+	params := make(map[string]string)
+	route := matchSegments(root, segments, params)
+	if route == nil {
+		return nil, nil
+	}
+	return route, params
+}
+
+// matchSegments walks segments against cur, trying the static child first and
+// backtracking into the param/wildcard child when the static branch doesn't
+// lead to a registered route. Without this, a route with a static segment
+// next to a param sibling (e.g. "/a/b/:y/z" alongside "/a/:x/c") can shadow
+// a match that the param branch would have found.
+func matchSegments(cur *node, segments []string, params map[string]string) *Route {
+	if len(segments) == 0 {
+		return cur.route
+	}
+
+	seg := segments[0]
+	rest := segments[1:]
+
+	if child, ok := cur.children[seg]; ok {
+		if route := matchSegments(child, rest, params); route != nil {
+			return route
+		}
+	}
+
+	if cur.paramChild != nil {
+		params[cur.paramChild.paramName] = seg
+		if route := matchSegments(cur.paramChild, rest, params); route != nil {
+			return route
+		}
+		delete(params, cur.paramChild.paramName)
+	}
+
+	if cur.wildcardChild != nil {
+		params[cur.wildcardChild.wildcardName] = strings.Join(segments, "/")
+		if cur.wildcardChild.route != nil {
+			return cur.wildcardChild.route
+		}
+		delete(params, cur.wildcardChild.wildcardName)
+	}
+
+	return nil
+}
+
+// trieMatchesPath reports whether path matches a trie route under some
+// method other than except, so process() can tell a 404 from a 405.
+func trieMatchesPath(path string, except string) bool {
+	segments := splitPath(path)
+	for method, root := range trieRoots {
+		if method == except {
+			continue
+		}
+		if route, _ := matchTrieNode(root, segments); route != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Param returns the named parameter extracted from a trie route (e.g.
+// Param("id") for a route registered as "/users/:id"), or "" if absent.
+func (c *Context) Param(name string) string {
+	if c.Params == nil {
+		return ""
+	}
+	return c.Params[name]
+}
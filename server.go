@@ -0,0 +1,85 @@
+package gower
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// Start the server
+func Start() {
+	srv := setup()
+	run(srv, srv.ListenAndServe)
+}
+
+// StartTLS starts the server serving HTTPS with the given certificate and
+// key files, with the same graceful shutdown behaviour as Start.
+func StartTLS(certFile string, keyFile string) {
+	srv := setup()
+	run(srv, func() error {
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	})
+}
+
+// setup wires up middleware, template watching and the static/dynamic
+// handlers shared by Start and StartTLS.
+func setup() *http.Server {
+	showInfo()
+
+	if ServerConfig.Csrf {
+		globalMiddleware = append([]Middleware{csrfMiddleware}, globalMiddleware...)
+	}
+
+	if ServerConfig.WatchTemplates {
+		watchTemplates()
+	}
+
+	http.Handle("/static/", ServeStatic())
+	http.HandleFunc("/", Process)
+
+	return &http.Server{Addr: ServerConfig.Host}
+}
+
+// run starts listen in the background and blocks until either it returns an
+// error or the process receives SIGINT/SIGTERM, in which case it drains
+// in-flight requests via srv.Shutdown before returning.
+func run(srv *http.Server, listen func() error) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := listen(); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+			return
+		}
+		serveErr <- nil
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case <-stop:
+		timeout := ServerConfig.ShutdownTimeout
+		if timeout == 0 {
+			timeout = defaultShutdownTimeout
+		}
+
+		log.Println("gower: shutting down, draining in-flight requests...")
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println("gower: graceful shutdown failed:", err)
+		}
+	}
+}
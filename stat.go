@@ -3,32 +3,116 @@ package gower
 import (
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Number of 1-second buckets kept for each sliding window.
+const (
+	minuteBuckets = 60
+	hourBuckets   = 3600
+	dayBuckets    = 86400
+	weekBuckets   = 604800
+)
+
+// window is a lock-free ring buffer of second-granularity buckets. Each slot
+// packs the unix second it was last written for and a count of requests seen
+// during that second into a single uint64 (high 32 bits: timestamp, low 32
+// bits: count), so a stale slot is reset and counted in one CAS instead of
+// two separate atomic ops that concurrent adders could interleave with.
+type window struct {
+	size  int64
+	slots []uint64
+}
+
+func newWindow(size int64) *window {
+	return &window{
+		size:  size,
+		slots: make([]uint64, size),
+	}
+}
+
+func packSlot(ts uint32, count uint32) uint64 {
+	return uint64(ts)<<32 | uint64(count)
+}
+
+func unpackSlot(v uint64) (ts uint32, count uint32) {
+	return uint32(v >> 32), uint32(v)
+}
+
+// add records one hit in the bucket for the given unix second.
+func (w *window) add(now int64) {
+	idx := now % w.size
+	nowTS := uint32(now)
+	for {
+		old := atomic.LoadUint64(&w.slots[idx])
+		oldTS, oldCount := unpackSlot(old)
+
+		var next uint64
+		if oldTS == nowTS {
+			next = packSlot(nowTS, oldCount+1)
+		} else {
+			// Stale slot: reset and count this hit in the same CAS, so no
+			// concurrent adder can observe a "reset" timestamp paired with
+			// a stale count and have its increment clobbered.
+			next = packSlot(nowTS, 1)
+		}
+
+		if atomic.CompareAndSwapUint64(&w.slots[idx], old, next) {
+			return
+		}
+		// Lost the race to another goroutine updating the same slot; retry.
+	}
+}
+
+// sum adds up every bucket whose timestamp falls within the last `span`
+// seconds, ending at `now`.
+func (w *window) sum(now int64, span int64) uint64 {
+	var total uint64
+	for i := int64(0); i < w.size; i++ {
+		ts, count := unpackSlot(atomic.LoadUint64(&w.slots[i]))
+		if t := int64(ts); t > now-span && t <= now {
+			total += uint64(count)
+		}
+	}
+	return total
+}
+
 // A structure to keep various stats about the server
 type Stat struct {
-	LastMinReqs  int
-	LastHourReqs int
-	LastDayReqs  int
-	LastWeekReqs int
-	TotalReqs    int
+	total uint64
+	reqs  sync.Map // status code string -> *uint64
+
+	minute *window
+	hour   *window
+	day    *window
+	week   *window
+
+	ServerStartedAt time.Time
+}
+
+// StatSnapshot is an immutable point-in-time copy of a Stat, safe to read
+// concurrently (e.g. serialize in a WriteJson handler) without touching the
+// live counters.
+type StatSnapshot struct {
+	LastMinReqs  uint64
+	LastHourReqs uint64
+	LastDayReqs  uint64
+	LastWeekReqs uint64
+	TotalReqs    uint64
 
-	Reqs            map[string]int
+	Reqs            map[string]uint64
 	ServerStartedAt time.Time
-	sync.Mutex
 }
 
 // Create a new stat datastructure
 func NewStat() *Stat {
 	return &Stat{
-		LastMinReqs:  0,
-		LastHourReqs: 0,
-		LastDayReqs:  0,
-		LastWeekReqs: 0,
-		TotalReqs:    0,
+		minute: newWindow(minuteBuckets),
+		hour:   newWindow(hourBuckets),
+		day:    newWindow(dayBuckets),
+		week:   newWindow(weekBuckets),
 
-		Reqs:            map[string]int{},
 		ServerStartedAt: time.Now(),
 	}
 }
@@ -40,18 +124,37 @@ func (s *Stat) GetUptime() time.Duration {
 
 // Increment the counter for requests served
 func (s *Stat) Increment(statusCode int, duration time.Duration) {
-	s.Lock()
-	defer s.Unlock()
+	atomic.AddUint64(&s.total, 1)
 
-	s.TotalReqs += 1
 	status := strconv.Itoa(statusCode)
-	s.Reqs[status] += 1
-
-	// (*) Note
-	// Investigate further !!!
-	// It appears that TotalReqs & Reqs[X] is a bit higher
-	// than the number of actual requests when tested for instance with
-	// "ab -c 100 -n 100 http://127.0.0.1/"
-	// Could it be a mutex problem?
-	// Are multiple goroutines updating the Stat object at the same time?
+	counter, _ := s.reqs.LoadOrStore(status, new(uint64))
+	atomic.AddUint64(counter.(*uint64), 1)
+
+	now := time.Now().Unix()
+	s.minute.add(now)
+	s.hour.add(now)
+	s.day.add(now)
+	s.week.add(now)
+}
+
+// Snapshot returns an immutable copy of the current stats.
+func (s *Stat) Snapshot() StatSnapshot {
+	now := time.Now().Unix()
+
+	reqs := make(map[string]uint64)
+	s.reqs.Range(func(k, v interface{}) bool {
+		reqs[k.(string)] = atomic.LoadUint64(v.(*uint64))
+		return true
+	})
+
+	return StatSnapshot{
+		LastMinReqs:  s.minute.sum(now, minuteBuckets),
+		LastHourReqs: s.hour.sum(now, hourBuckets),
+		LastDayReqs:  s.day.sum(now, dayBuckets),
+		LastWeekReqs: s.week.sum(now, weekBuckets),
+		TotalReqs:    atomic.LoadUint64(&s.total),
+
+		Reqs:            reqs,
+		ServerStartedAt: s.ServerStartedAt,
+	}
 }
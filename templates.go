@@ -0,0 +1,138 @@
+package gower
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/flosch/pongo2"
+	"github.com/fsnotify/fsnotify"
+)
+
+var (
+	templateCache   = make(map[string]pongo2.Template)
+	templateCacheMu sync.RWMutex
+)
+
+// Render a template from disk (or from templateCache when not in Debug mode
+// and WatchTemplates hasn't already invalidated the entry)
+func renderTemplate(filepath string, data map[string]interface{}) []byte {
+
+	var out string
+	var err error
+	var tmpl pongo2.Template
+
+	// Read the template from the disk every time
+	if ServerConfig.Debug {
+		newTemplate, err := pongo2.FromFile(filepath)
+		if err != nil {
+			panic(err)
+		}
+		tmpl = *newTemplate
+
+	} else {
+		templateCacheMu.RLock()
+		cached, ok := templateCache[filepath]
+		templateCacheMu.RUnlock()
+
+		if !ok {
+			newTemplate, err := pongo2.FromFile(filepath)
+			if err != nil {
+				panic(err)
+			}
+			templateCacheMu.Lock()
+			templateCache[filepath] = *newTemplate
+			templateCacheMu.Unlock()
+			cached = *newTemplate
+		}
+		tmpl = cached
+	}
+
+	out, err = tmpl.Execute(data)
+	if err != nil {
+		panic(err)
+	}
+	return []byte(out)
+}
+
+// Render template and write it to Response
+func (c *Context) WriteTemplate(filename string, data map[string]interface{}) {
+	c.Res.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if token, ok := c.Get("csrf_token").(string); ok {
+		if _, exists := data["csrf_token"]; !exists {
+			merged := make(map[string]interface{}, len(data)+1)
+			for k, v := range data {
+				merged[k] = v
+			}
+			merged["csrf_token"] = token
+			data = merged
+		}
+	}
+
+	filepath := ServerConfig.TemplateDir + "/" + filename
+	str := renderTemplate(filepath, data)
+	c.Res.Write(str)
+}
+
+// watchTemplates starts an fsnotify watcher rooted at ServerConfig.TemplateDir
+// and invalidates just the affected templateCache entry when a *.html file
+// changes on disk, giving production-safe live reload without paying the
+// per-request parse cost that Debug mode takes.
+func watchTemplates() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("gower: could not start template watcher:", err)
+		return
+	}
+
+	if err := watcher.Add(ServerConfig.TemplateDir); err != nil {
+		log.Println("gower: could not watch template dir:", err)
+		return
+	}
+
+	pendingRemoved := make(map[string]bool)
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !strings.HasSuffix(event.Name, ".html") {
+					continue
+				}
+
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					invalidateTemplate(event.Name)
+				}
+
+				switch {
+				case event.Op&fsnotify.Remove != 0:
+					// Many editors save by removing the old file and
+					// creating a new one in its place; remember that so a
+					// following Create on the same path re-adds the watch.
+					pendingRemoved[event.Name] = true
+				case event.Op&fsnotify.Create != 0 && pendingRemoved[event.Name]:
+					delete(pendingRemoved, event.Name)
+					if err := watcher.Add(event.Name); err != nil {
+						log.Println("gower: could not re-watch", event.Name, ":", err)
+					}
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("gower: template watcher error:", err)
+			}
+		}
+	}()
+}
+
+func invalidateTemplate(filepath string) {
+	templateCacheMu.Lock()
+	delete(templateCache, filepath)
+	templateCacheMu.Unlock()
+}